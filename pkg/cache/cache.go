@@ -5,44 +5,656 @@ package cache
 
 import (
 	"container/list"
+	"context"
+	"errors"
 	"hash/maphash"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// MaxCacheSize defines the maximum cache size. It should satisfy
-// 1 <= MaxCacheSize <= 10000, but for some test cases it should
-// satisfy more (check them).
-const MaxCacheSize = 5
+// ErrInvalidCapacity is returned by NewCache when the requested capacity is
+// not positive.
+var ErrInvalidCapacity = errors.New("cache: capacity must be a positive number")
 
-// NewCache makes and returns a new instance of cache.
-func NewCache[V any]() *lruCache[V] {
-	return &lruCache[V]{
-		seed: maphash.MakeSeed(),
+// ErrMissingSizer is returned by NewCache when WithMaxBytes is used without
+// WithSizer, unless V is []byte (which defaults to ByteSizer).
+var ErrMissingSizer = errors.New("cache: WithMaxBytes requires WithSizer for this value type")
+
+// Sizer computes the size in bytes that a (key, value) pair should count
+// against a Cache's byte budget. See WithMaxBytes.
+type Sizer[V any] func(key string, v V) int64
+
+// ByteSizer is the default Sizer for Cache[[]byte]: it counts the length of
+// the value, ignoring the key.
+func ByteSizer(_ string, v []byte) int64 {
+	return int64(len(v))
+}
+
+// Timer is the subset of *time.Timer used by the cache to schedule TTL
+// expirations. It exists so that Clock implementations can hand back fakes in
+// tests.
+type Timer interface {
+	Stop() bool
+}
+
+// Clock abstracts timer creation so that TTL expiration can be driven
+// deterministically in tests instead of depending on wall-clock sleeps.
+type Clock interface {
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Policy selects the eviction algorithm used by a Cache.
+type Policy int
+
+const (
+	// PolicyLRU evicts the least recently used record. It's the default.
+	PolicyLRU Policy = iota
+	// PolicySieve uses the SIEVE algorithm: a single FIFO queue with a
+	// per-record visited bit, as adopted by dnscrypt-proxy's cache plugin.
+	// It approaches the hit ratio of more elaborate policies like ARC while
+	// keeping Get down to a bit flip instead of a list move. Note that Get
+	// still takes Cache's exclusive lock and relinks the bucket chain for
+	// every policy, including this one, so that bit flip doesn't yet buy
+	// the concurrent-read scaling a read-locked Get could offer; it only
+	// saves the list move SIEVE's own bookkeeping would otherwise need.
+	PolicySieve
+	// Policy2Q is the 2Q algorithm (as in hashicorp/golang-lru): a FIFO of
+	// recently admitted entries feeds an LRU list of frequently used ones,
+	// with a ghost list of recently evicted FIFO keys so a second access
+	// promotes straight to the frequent list. It resists scan pollution
+	// much better than plain LRU.
+	Policy2Q
+	// PolicyARC is the Adaptive Replacement Cache algorithm: it balances a
+	// recency list and a frequency list against each other, using ghost
+	// lists of recently evicted keys from each to continuously retune the
+	// balance to the workload.
+	PolicyARC
+)
+
+// EvictReason identifies why a record left the cache, reported to the
+// callback registered via WithOnEvict.
+type EvictReason int
+
+const (
+	// EvictReasonCapacity means the record was evicted to keep the cache
+	// within its configured capacity or byte budget.
+	EvictReasonCapacity EvictReason = iota
+	// EvictReasonExpired means the record's TTL elapsed.
+	EvictReasonExpired
+	// EvictReasonDeleted means the record was removed by an explicit Delete,
+	// Remove or Purge call.
+	EvictReasonDeleted
+)
+
+// Option configures a Cache at construction time. See WithEvictionCallback,
+// WithClock, WithHashSeed and WithPolicy.
+type Option[V any] func(*options[V])
+
+type options[V any] struct {
+	onEvict       func(key string, v V)
+	onEvictReason func(reason EvictReason, key string, v V)
+	clock         Clock
+	policy        Policy
+	seed          maphash.Seed
+	hasSeed       bool
+	sizer         Sizer[V]
+	maxBytes      int64
+	minEntries    int
+	shards        int
+}
+
+// WithEvictionCallback registers a function that is called whenever a record
+// leaves the cache, whether by capacity eviction, TTL expiration or explicit
+// deletion. It runs while the Cache's internal lock is held, so it must not
+// call back into the cache (even Get, Peek or Len), or it will deadlock.
+func WithEvictionCallback[V any](f func(key string, v V)) Option[V] {
+	return func(o *options[V]) { o.onEvict = f }
+}
+
+// WithOnEvict registers a function that is called whenever a record leaves
+// the cache, like WithEvictionCallback, but additionally reports why via
+// EvictReason. Use it when cleanup needs to distinguish capacity eviction
+// and TTL expiration from an explicit Delete, e.g. to avoid decrementing a
+// refcount twice for the same record. Like WithEvictionCallback, it runs
+// while the Cache's internal lock is held, so it must not call back into
+// the cache (even Get, Peek or Len), or it will deadlock.
+func WithOnEvict[V any](f func(reason EvictReason, key string, v V)) Option[V] {
+	return func(o *options[V]) { o.onEvictReason = f }
+}
+
+// WithClock overrides the Clock used to schedule TTL expirations. It's
+// mainly useful in tests that need deterministic control over time.
+func WithClock[V any](clock Clock) Option[V] {
+	return func(o *options[V]) { o.clock = clock }
+}
+
+// WithHashSeed fixes the seed used by the bucket hash function. Without it, a
+// random seed is generated for every cache instance.
+func WithHashSeed[V any](seed maphash.Seed) Option[V] {
+	return func(o *options[V]) { o.seed, o.hasSeed = seed, true }
+}
+
+// WithPolicy selects the eviction policy. The default is PolicyLRU.
+func WithPolicy[V any](p Policy) Option[V] {
+	return func(o *options[V]) { o.policy = p }
+}
+
+// WithSizer sets the Sizer used to weigh entries against the budget set by
+// WithMaxBytes. It has no effect without WithMaxBytes.
+func WithSizer[V any](s Sizer[V]) Option[V] {
+	return func(o *options[V]) { o.sizer = s }
+}
+
+// WithMaxBytes bounds the cache by total payload size, in addition to
+// capacity: entries are evicted, per the configured Policy, until a newly
+// set record fits within maxBytes. It requires a Sizer, via WithSizer,
+// except for Cache[[]byte] which defaults to ByteSizer.
+func WithMaxBytes[V any](maxBytes int64) Option[V] {
+	return func(o *options[V]) { o.maxBytes = maxBytes }
+}
+
+// WithMinEntries floors how far WithMaxBytes eviction will shrink the
+// cache, so that a handful of oversized values can't push occupancy to
+// zero. It has no effect without WithMaxBytes.
+func WithMinEntries[V any](n int) Option[V] {
+	return func(o *options[V]) { o.minEntries = n }
+}
+
+// WithShards sets how many shards NewShardedCache splits capacity across,
+// rounded up to the next power of two. It's ignored by NewCache. The
+// default is the next power of two >= runtime.GOMAXPROCS(0).
+func WithShards[V any](n int) Option[V] {
+	return func(o *options[V]) { o.shards = n }
+}
+
+// NewCacheWithPolicy makes and returns a new instance of cache with room for
+// capacity entries, using the given eviction Policy. It's equivalent to
+// calling NewCache with WithPolicy(p) prepended to opts.
+func NewCacheWithPolicy[V any](capacity int, p Policy, opts ...Option[V]) (*Cache[V], error) {
+	return NewCache[V](capacity, append([]Option[V]{WithPolicy[V](p)}, opts...)...)
+}
+
+// NewCache makes and returns a new instance of cache with room for capacity
+// entries. capacity must be a positive number.
+func NewCache[V any](capacity int, opts ...Option[V]) (*Cache[V], error) {
+	if capacity <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+
+	o := options[V]{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&o)
 	}
+
+	if o.maxBytes > 0 && o.sizer == nil {
+		s, ok := any(Sizer[[]byte](ByteSizer)).(Sizer[V])
+		if !ok {
+			return nil, ErrMissingSizer
+		}
+		o.sizer = s
+	}
+
+	seed := o.seed
+	if !o.hasSeed {
+		seed = maphash.MakeSeed()
+	}
+
+	buckets := bucketCountFor(capacity)
+	return &Cache[V]{
+		capacity:      capacity,
+		mask:          buckets - 1,
+		seed:          seed,
+		clock:         o.clock,
+		onEvict:       o.onEvict,
+		onEvictReason: o.onEvictReason,
+		policy:        newPolicy[V](o.policy, capacity),
+		sizer:         o.sizer,
+		maxBytes:      o.maxBytes,
+		minEntries:    o.minEntries,
+		data:          make([]*record[V], buckets),
+		loads:         make(map[string]*call[V]),
+	}, nil
+}
+
+// bucketCountFor returns the smallest power of two that is >= capacity, so
+// that the hash bucket count grows with capacity instead of being fixed,
+// keeping chain lengths short regardless of how large capacity is.
+func bucketCountFor(capacity int) uint64 {
+	n := uint64(1)
+	for n < uint64(capacity) {
+		n <<= 1
+	}
+	return n
+}
+
+// Cache is the LRU cache structure. It should be created by NewCache.
+type Cache[V any] struct {
+	m             sync.Mutex
+	size          int                          // size holds the cache size. It should always satisfy size <= capacity.
+	capacity      int                          // capacity holds the maximum number of records the cache can hold.
+	mask          uint64                       // mask is len(data)-1, used to map a hash to a bucket index.
+	seed          maphash.Seed                 // seed is used for seeding hash algorithm. It must be read-only after initialization.
+	clock         Clock                        // clock schedules TTL expirations.
+	onEvict       func(string, V)              // onEvict, if set, is called whenever a record leaves the cache.
+	onEvictReason func(EvictReason, string, V) // onEvictReason, if set, is like onEvict but reports why.
+	policy        evictionPolicy[V]            // policy picks eviction victims and tracks whatever bookkeeping it needs.
+	sizer         Sizer[V]                     // sizer weighs entries for maxBytes. Nil if WithMaxBytes wasn't used.
+	bytes         int64                        // bytes holds the running total weighed by sizer. It can exceed maxBytes only when minEntries, or a single record larger than maxBytes, keeps oversized records resident.
+	maxBytes      int64                        // maxBytes is the byte budget from WithMaxBytes. <= 0 means no budget.
+	minEntries    int                          // minEntries floors how far maxBytes eviction will shrink the cache.
+	data          []*record[V]                 // data holds the cache records in buckets. Each bucket holds a simple linked list.
+	hits          atomic.Int64                 // hits counts successful Get calls.
+	misses        atomic.Int64                 // misses counts unsuccessful Get calls.
+	evictions     atomic.Int64                 // evictions counts records removed to respect capacity or the byte budget.
+	expirations   atomic.Int64                 // expirations counts records removed because their TTL elapsed.
+	loadMu        sync.Mutex                   // loadMu guards loads. It's separate from m so in-flight loaders never block unrelated Get/Set calls.
+	loads         map[string]*call[V]
 }
 
-// lruCache is the LRU cache structure. It's not exported and should be used by
-// NewCache function.
-type lruCache[V any] struct {
-	m    sync.Mutex
-	size uint64                   // size holds the cache size. It should always satisfy size <= MaxCacheSize.
-	seed maphash.Seed             // seed is used for seeding hash algorithm. It must be read-only after initialization.
-	lru  list.List                // lru holds the LRU metadata as a doubly linked list.
-	data [MaxCacheSize]*record[V] // data holds the cache records as an array. Each entry holds a simple linked list.
+// call is an in-flight GetOrLoad, shared by every caller that misses on the
+// same key concurrently.
+type call[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// Stats holds cumulative counters for a Cache or ShardedCache.
+type Stats struct {
+	Hits        int64
+	Misses      int64
+	Evictions   int64
+	Expirations int64
 }
 
 type record[V any] struct {
 	key   string
 	val   V
 	below *record[V]
-	t     *time.Timer // t is just uses to kill the TTL process when the key will be reset
-	e     *list.Element
+	t     Timer         // t is just uses to kill the TTL process when the key will be reset
+	e     *list.Element // e is the policy's own list element for this record.
+	// visited is only meaningful under PolicySieve. It's a plain bool, not
+	// atomic: every read/write happens while Get or Set holds c.m, same as
+	// every other policy's bookkeeping. SIEVE's bit-flip touch was meant to
+	// eventually let Get run under an RWMutex.RLock instead of the exclusive
+	// sync.Mutex it shares with every other policy, but Get still relinks
+	// the bucket chain unconditionally on every hit, so that speedup isn't
+	// realized yet; it would need a SIEVE-specific Get path first.
+	visited bool
+}
+
+// evictionPolicy decides which record to evict once a cache is full, and
+// owns whatever recency/frequency bookkeeping its algorithm needs. It is
+// independent from the hash bucket chaining in Cache, which only exists for
+// key lookup.
+type evictionPolicy[V any] interface {
+	// insert registers a newly added record with the policy.
+	insert(r *record[V])
+	// touch is called on every successful Get or reset Set for r.
+	touch(r *record[V])
+	// remove takes a record out of the policy's bookkeeping, e.g. for
+	// explicit deletion or TTL expiration.
+	remove(r *record[V])
+	// evict picks a victim, removes it from the policy's bookkeeping and
+	// returns it. It must only be called while the policy holds a record.
+	evict() *record[V]
+	// records returns every record the policy currently holds, ordered from
+	// most to least recently used, or the closest approximation the
+	// algorithm can offer (e.g. SIEVE only tracks FIFO admission order).
+	records() []*record[V]
+}
+
+func newPolicy[V any](p Policy, capacity int) evictionPolicy[V] {
+	switch p {
+	case PolicySieve:
+		return &sievePolicy[V]{}
+	case Policy2Q:
+		return &twoQPolicy[V]{
+			capacity:   capacity,
+			a1outIndex: make(map[string]*list.Element),
+		}
+	case PolicyARC:
+		return &arcPolicy[V]{
+			capacity: capacity,
+			b1Index:  make(map[string]*list.Element),
+			b2Index:  make(map[string]*list.Element),
+		}
+	default:
+		return &lruPolicy[V]{}
+	}
+}
+
+// lruPolicy evicts the least recently used record, using a doubly linked
+// list ordered from most to least recently used.
+type lruPolicy[V any] struct {
+	list list.List
+}
+
+func (p *lruPolicy[V]) insert(r *record[V]) {
+	r.e = p.list.PushFront(r)
+}
+
+func (p *lruPolicy[V]) touch(r *record[V]) {
+	p.list.MoveToFront(r.e)
+}
+
+func (p *lruPolicy[V]) remove(r *record[V]) {
+	p.list.Remove(r.e)
+}
+
+func (p *lruPolicy[V]) evict() *record[V] {
+	e := p.list.Back()
+	p.list.Remove(e)
+	return e.Value.(*record[V])
+}
+
+func (p *lruPolicy[V]) records() []*record[V] {
+	recs := make([]*record[V], 0, p.list.Len())
+	for e := p.list.Front(); e != nil; e = e.Next() {
+		recs = append(recs, e.Value.(*record[V]))
+	}
+	return recs
+}
+
+// sievePolicy implements the SIEVE algorithm: a single FIFO queue with a
+// per-record visited bit that's set on touch. Eviction walks a hand from the
+// tail toward the head, clearing the visited bit of every record it passes
+// over and evicting the first one it finds already unvisited. Unlike LRU,
+// touch never moves anything in the list, so it's a plain bit flip.
+type sievePolicy[V any] struct {
+	list list.List
+	hand *list.Element
+}
+
+func (p *sievePolicy[V]) insert(r *record[V]) {
+	r.e = p.list.PushFront(r)
+}
+
+func (p *sievePolicy[V]) touch(r *record[V]) {
+	r.visited = true
+}
+
+func (p *sievePolicy[V]) remove(r *record[V]) {
+	if p.hand == r.e {
+		p.hand = p.advanceHand(r.e)
+	}
+	p.list.Remove(r.e)
+	if p.list.Len() == 0 {
+		p.hand = nil
+	}
+}
+
+func (p *sievePolicy[V]) evict() *record[V] {
+	e := p.hand
+	if e == nil {
+		e = p.list.Back()
+	}
+
+	for {
+		r := e.Value.(*record[V])
+		if r.visited {
+			r.visited = false
+			e = p.advanceHand(e)
+			continue
+		}
+
+		p.hand = p.advanceHand(e)
+		p.list.Remove(e)
+		if p.list.Len() == 0 {
+			p.hand = nil
+		}
+		return r
+	}
+}
+
+func (p *sievePolicy[V]) records() []*record[V] {
+	recs := make([]*record[V], 0, p.list.Len())
+	for e := p.list.Front(); e != nil; e = e.Next() {
+		recs = append(recs, e.Value.(*record[V]))
+	}
+	return recs
+}
+
+// advanceHand returns the element the hand should move to after considering
+// e: the predecessor toward the head, or the tail again once it falls off
+// the head.
+func (p *sievePolicy[V]) advanceHand(e *list.Element) *list.Element {
+	if prev := e.Prev(); prev != nil {
+		return prev
+	}
+	return p.list.Back()
+}
+
+// twoQList identifies which of 2Q's sub-lists a record currently belongs to.
+type twoQList uint8
+
+const (
+	twoQListA1in twoQList = iota
+	twoQListAm
+)
+
+type twoQNode[V any] struct {
+	rec  *record[V]
+	list twoQList
+}
+
+// twoQPolicy implements the 2Q algorithm: A1in is a FIFO of recently
+// admitted records, Am is an LRU list of records that have proven
+// frequently used, and A1out is a ghost list of keys recently evicted from
+// A1in, so that a second access within the ghost window promotes a record
+// straight into Am instead of making it churn through A1in again.
+type twoQPolicy[V any] struct {
+	capacity int
+
+	am, a1in   list.List
+	a1out      list.List
+	a1outIndex map[string]*list.Element
+}
+
+func (p *twoQPolicy[V]) a1inTarget() int {
+	if t := p.capacity / 4; t > 0 {
+		return t
+	}
+	return 1
+}
+
+func (p *twoQPolicy[V]) a1outTarget() int {
+	if t := p.capacity / 2; t > 0 {
+		return t
+	}
+	return 1
+}
+
+func (p *twoQPolicy[V]) insert(r *record[V]) {
+	if el, ok := p.a1outIndex[r.key]; ok {
+		p.a1out.Remove(el)
+		delete(p.a1outIndex, r.key)
+		r.e = p.am.PushFront(&twoQNode[V]{rec: r, list: twoQListAm})
+		return
+	}
+	r.e = p.a1in.PushFront(&twoQNode[V]{rec: r, list: twoQListA1in})
+}
+
+func (p *twoQPolicy[V]) touch(r *record[V]) {
+	node := r.e.Value.(*twoQNode[V])
+	if node.list == twoQListAm {
+		p.am.MoveToFront(r.e)
+	}
+	// A Get on A1in is left untouched: 2Q only promotes on a second admission.
+}
+
+func (p *twoQPolicy[V]) remove(r *record[V]) {
+	node := r.e.Value.(*twoQNode[V])
+	if node.list == twoQListAm {
+		p.am.Remove(r.e)
+	} else {
+		p.a1in.Remove(r.e)
+	}
+}
+
+func (p *twoQPolicy[V]) evict() *record[V] {
+	if p.a1in.Len() > p.a1inTarget() || p.am.Len() == 0 {
+		e := p.a1in.Back()
+		node := e.Value.(*twoQNode[V])
+		p.a1in.Remove(e)
+		p.pushGhost(node.rec.key)
+		return node.rec
+	}
+
+	e := p.am.Back()
+	node := e.Value.(*twoQNode[V])
+	p.am.Remove(e)
+	return node.rec
+}
+
+func (p *twoQPolicy[V]) records() []*record[V] {
+	recs := make([]*record[V], 0, p.am.Len()+p.a1in.Len())
+	for e := p.am.Front(); e != nil; e = e.Next() {
+		recs = append(recs, e.Value.(*twoQNode[V]).rec)
+	}
+	for e := p.a1in.Front(); e != nil; e = e.Next() {
+		recs = append(recs, e.Value.(*twoQNode[V]).rec)
+	}
+	return recs
+}
+
+func (p *twoQPolicy[V]) pushGhost(key string) {
+	p.a1outIndex[key] = p.a1out.PushFront(key)
+	if p.a1out.Len() > p.a1outTarget() {
+		tail := p.a1out.Back()
+		delete(p.a1outIndex, tail.Value.(string))
+		p.a1out.Remove(tail)
+	}
+}
+
+// arcList identifies which of ARC's two real-entry lists a record currently
+// belongs to.
+type arcList uint8
+
+const (
+	arcListT1 arcList = iota
+	arcListT2
+)
+
+type arcNode[V any] struct {
+	rec  *record[V]
+	list arcList
+}
+
+// arcPolicy implements the Adaptive Replacement Cache algorithm: T1 is a
+// recency list and T2 a frequency list of real records, each backed by a
+// ghost list (B1, B2) of recently evicted keys. p is the adaptive target
+// size for T1; every ghost hit nudges it toward whichever list is
+// "winning", so the recency/frequency balance tracks the workload.
+type arcPolicy[V any] struct {
+	capacity int
+	p        int
+
+	t1, t2  list.List
+	b1, b2  list.List
+	b1Index map[string]*list.Element
+	b2Index map[string]*list.Element
+}
+
+func (p *arcPolicy[V]) insert(r *record[V]) {
+	if el, ok := p.b1Index[r.key]; ok {
+		delta := 1
+		if p.b1.Len() > 0 && p.b2.Len() > p.b1.Len() {
+			delta = p.b2.Len() / p.b1.Len()
+		}
+		p.p = min(p.capacity, p.p+delta)
+
+		p.b1.Remove(el)
+		delete(p.b1Index, r.key)
+		r.e = p.t2.PushFront(&arcNode[V]{rec: r, list: arcListT2})
+		return
+	}
+
+	if el, ok := p.b2Index[r.key]; ok {
+		delta := 1
+		if p.b2.Len() > 0 && p.b1.Len() > p.b2.Len() {
+			delta = p.b1.Len() / p.b2.Len()
+		}
+		p.p = max(0, p.p-delta)
+
+		p.b2.Remove(el)
+		delete(p.b2Index, r.key)
+		r.e = p.t2.PushFront(&arcNode[V]{rec: r, list: arcListT2})
+		return
+	}
+
+	r.e = p.t1.PushFront(&arcNode[V]{rec: r, list: arcListT1})
+}
+
+func (p *arcPolicy[V]) touch(r *record[V]) {
+	node := r.e.Value.(*arcNode[V])
+	if node.list == arcListT2 {
+		p.t2.MoveToFront(r.e)
+		return
+	}
+
+	p.t1.Remove(r.e)
+	node.list = arcListT2
+	r.e = p.t2.PushFront(node)
+}
+
+func (p *arcPolicy[V]) remove(r *record[V]) {
+	node := r.e.Value.(*arcNode[V])
+	if node.list == arcListT1 {
+		p.t1.Remove(r.e)
+	} else {
+		p.t2.Remove(r.e)
+	}
+}
+
+func (p *arcPolicy[V]) evict() *record[V] {
+	if p.t1.Len() > 0 && p.t1.Len() > p.p {
+		return p.evictFrom(&p.t1, &p.b1, p.b1Index)
+	}
+	if p.t2.Len() > 0 {
+		return p.evictFrom(&p.t2, &p.b2, p.b2Index)
+	}
+	return p.evictFrom(&p.t1, &p.b1, p.b1Index)
+}
+
+func (p *arcPolicy[V]) records() []*record[V] {
+	recs := make([]*record[V], 0, p.t1.Len()+p.t2.Len())
+	for e := p.t2.Front(); e != nil; e = e.Next() {
+		recs = append(recs, e.Value.(*arcNode[V]).rec)
+	}
+	for e := p.t1.Front(); e != nil; e = e.Next() {
+		recs = append(recs, e.Value.(*arcNode[V]).rec)
+	}
+	return recs
+}
+
+func (p *arcPolicy[V]) evictFrom(from, ghost *list.List, ghostIndex map[string]*list.Element) *record[V] {
+	e := from.Back()
+	node := e.Value.(*arcNode[V])
+	from.Remove(e)
+
+	ghostIndex[node.rec.key] = ghost.PushFront(node.rec.key)
+	if ghost.Len() > p.capacity {
+		tail := ghost.Back()
+		delete(ghostIndex, tail.Value.(string))
+		ghost.Remove(tail)
+	}
+
+	return node.rec
 }
 
 // Get gets the value corresponding to a requested key. It returns false if
 // the key does not exist.
-func (c *lruCache[V]) Get(key string) (v V, found bool) {
+func (c *Cache[V]) Get(key string) (v V, found bool) {
 	i := c.hash(key)
 
 	c.m.Lock()
@@ -55,29 +667,200 @@ func (c *lruCache[V]) Get(key string) (v V, found bool) {
 			r.below = root
 			c.data[i] = r
 		}
-		c.lru.MoveToFront(r.e)
+		c.policy.touch(r)
+		c.hits.Add(1)
 		return r.val, true
 	}
+	c.misses.Add(1)
 	return
 }
 
+// GetOrLoad returns the cached value for key if present. Otherwise it calls
+// loader exactly once, even under concurrent misses for the same key, and
+// stores the result with ttl before returning it to every waiter. ctx only
+// governs how long this particular call is willing to wait: if it's
+// canceled, GetOrLoad returns ctx.Err() while the loader keeps running in
+// the background to populate the entry for everyone else.
+func (c *Cache[V]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context, key string) (V, error)) (V, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+
+	c.loadMu.Lock()
+	if cl, ok := c.loads[key]; ok {
+		c.loadMu.Unlock()
+		return waitForCall(ctx, cl)
+	}
+
+	cl := &call[V]{done: make(chan struct{})}
+	c.loads[key] = cl
+	c.loadMu.Unlock()
+
+	go func() {
+		cl.val, cl.err = loader(context.Background(), key)
+
+		c.loadMu.Lock()
+		delete(c.loads, key)
+		c.loadMu.Unlock()
+
+		if cl.err == nil {
+			c.Set(key, cl.val, ttl)
+		}
+		close(cl.done)
+	}()
+
+	return waitForCall(ctx, cl)
+}
+
+// waitForCall blocks until cl is resolved or ctx is done, whichever comes
+// first.
+func waitForCall[V any](ctx context.Context, cl *call[V]) (V, error) {
+	select {
+	case <-cl.done:
+		return cl.val, cl.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Delete removes key from the cache. It reports whether the key was
+// present.
+func (c *Cache[V]) Delete(key string) bool {
+	i := c.hash(key)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	r, _, _ := c.lookup(i, key)
+	if r == nil {
+		return false
+	}
+	c.delete(i, key, EvictReasonDeleted)
+	return true
+}
+
+// Remove is a synonym for Delete.
+func (c *Cache[V]) Remove(key string) bool {
+	return c.Delete(key)
+}
+
+// Len returns the number of records currently in the cache.
+func (c *Cache[V]) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.size
+}
+
+// Cap returns the cache's capacity, as set by NewCache.
+func (c *Cache[V]) Cap() int {
+	return c.capacity
+}
+
+// Stats returns a snapshot of the cache's cumulative counters.
+func (c *Cache[V]) Stats() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// Keys returns every key currently in the cache, ordered from most to least
+// recently used as tracked by the configured Policy.
+func (c *Cache[V]) Keys() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	recs := c.policy.records()
+	keys := make([]string, len(recs))
+	for i, r := range recs {
+		keys[i] = r.key
+	}
+	return keys
+}
+
+// Range calls f for every record in the cache, in the same order as Keys,
+// until f returns false or every record has been visited. f must not call
+// back into the cache.
+func (c *Cache[V]) Range(f func(key string, v V) bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, r := range c.policy.records() {
+		if !f(r.key, r.val) {
+			return
+		}
+	}
+}
+
+// Peek returns the value for key, like Get, but without marking it as
+// recently used.
+func (c *Cache[V]) Peek(key string) (v V, found bool) {
+	i := c.hash(key)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if r, _, _ := c.lookup(i, key); r != nil {
+		return r.val, true
+	}
+	return
+}
+
+// Purge removes every record from the cache, firing the eviction callbacks
+// registered via WithEvictionCallback or WithOnEvict for each one with
+// EvictReasonDeleted.
+func (c *Cache[V]) Purge() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	recs := c.policy.records()
+	keys := make([]string, len(recs))
+	for i, r := range recs {
+		keys[i] = r.key
+	}
+	for _, key := range keys {
+		c.delete(c.hash(key), key, EvictReasonDeleted)
+	}
+}
+
 // Set sets a new (key, value, ttl) record in the cache. If key exists, value
 // and ttl will be reset for the key. If the size of cache exceeded from
-// MaxCacheSize, it evicts an entry based on LRU policy.
-func (c *lruCache[V]) Set(key string, value V, ttl time.Duration) {
+// capacity, it evicts an entry based on the configured Policy.
+func (c *Cache[V]) Set(key string, value V, ttl time.Duration) {
 	i := c.hash(key)
+	newBytes := c.sizeOf(key, value)
 
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	switch r, above, root := c.lookup(i, key); {
-	case r != nil: // reset
+	r, above, root := c.lookup(i, key)
+	if r != nil { // reset
+		delta := newBytes - c.sizeOf(r.key, r.val)
+		c.policy.touch(r) // promote r first so the eviction below can't pick it as the victim
+
+		for c.maxBytes > 0 && c.bytes+delta > c.maxBytes && c.size > c.minEntries {
+			er := c.policy.evict()
+			if er == r { // r was the only evictable record left; put it back
+				c.policy.insert(r)
+				break
+			}
+			c.unlink(c.hash(er.key), er.key, EvictReasonCapacity)
+		}
+
+		c.bytes += delta
 		r.t.Stop()
 		r.val = value
-		r.t = time.AfterFunc(ttl, func() {
+		r.t = c.clock.AfterFunc(ttl, func() {
 			c.deleteWithLock(i, key)
 		})
 
+		// Re-lookup: the eviction above may have unlinked other records from
+		// bucket i, which would leave the above/root captured before it stale.
+		_, above, root = c.lookup(i, key)
+
 		// Bring r to the top
 		if r != root {
 			above.below = r.below
@@ -85,33 +868,59 @@ func (c *lruCache[V]) Set(key string, value V, ttl time.Duration) {
 			c.data[i] = r
 		}
 
-		c.lru.MoveToFront(r.e)
-	case c.size == MaxCacheSize: // evict and set
-		er := c.lru.Back().Value.(*record[V])
+		return
+	}
+
+	for c.mustEvict(newBytes) { // evict until the newcomer fits
+		er := c.policy.evict()
 		if er == root {
 			root = root.below
 		}
-		c.delete(c.hash(er.key), er.key)
-		fallthrough
-	default: // set
-		r = &record[V]{
-			key:   key,
-			val:   value,
-			below: root,
-			t: time.AfterFunc(ttl, func() {
-				c.deleteWithLock(i, key)
-			}),
-		}
-		r.e = c.lru.PushFront(r)
-		c.data[i] = r // Bring r to the top
-		c.size++
+		c.unlink(c.hash(er.key), er.key, EvictReasonCapacity)
+	}
+
+	r = &record[V]{
+		key:   key,
+		val:   value,
+		below: root,
+		t: c.clock.AfterFunc(ttl, func() {
+			c.deleteWithLock(i, key)
+		}),
+	}
+	c.policy.insert(r)
+	c.data[i] = r // Bring r to the top
+	c.size++
+	c.bytes += newBytes
+}
+
+// mustEvict reports whether a newcomer weighing newBytes needs a record
+// evicted first to respect capacity or, if set, the WithMaxBytes budget.
+// Capacity is always enforced; byte-budget eviction stops once size has been
+// shrunk down to minEntries.
+func (c *Cache[V]) mustEvict(newBytes int64) bool {
+	if c.size >= c.capacity {
+		return true
+	}
+	if c.size <= c.minEntries {
+		return false
 	}
+	return c.maxBytes > 0 && c.bytes+newBytes > c.maxBytes
 }
 
-// lookup finds the corresponding records for a key within i'th entry in c.data
-// array. It returns the record itself (if any), the one above that (if any),
-// and the root record (if any). It must be executed within a transaction
-func (c *lruCache[V]) lookup(i uint64, key string) (rec, above, root *record[V]) {
+// sizeOf weighs a (key, value) pair using sizer, or 0 if WithMaxBytes
+// wasn't used.
+func (c *Cache[V]) sizeOf(key string, v V) int64 {
+	if c.sizer == nil {
+		return 0
+	}
+	return c.sizer(key, v)
+}
+
+// lookup finds the corresponding records for a key within i'th bucket in
+// c.data. It returns the record itself (if any), the one above that (if
+// any), and the root record (if any). It must be executed within a
+// transaction.
+func (c *Cache[V]) lookup(i uint64, key string) (rec, above, root *record[V]) {
 	c.mustBeLocked()
 
 	root = c.data[i]
@@ -122,15 +931,33 @@ func (c *lruCache[V]) lookup(i uint64, key string) (rec, above, root *record[V])
 	return
 }
 
-func (c *lruCache[V]) deleteWithLock(idx uint64, key string) {
+func (c *Cache[V]) deleteWithLock(idx uint64, key string) {
 	c.m.Lock()
 	defer c.m.Unlock()
-	c.delete(idx, key)
+	c.delete(idx, key, EvictReasonExpired)
 }
 
-// delete deletes a key from cache. It receives both key and idx and they must
-// be consistent. This method must be executed within a cache transaction.
-func (c *lruCache[V]) delete(idx uint64, key string) {
+// delete removes a key from the cache, including the eviction policy's own
+// bookkeeping. It receives both key and idx and they must be consistent.
+// This method must be executed within a cache transaction.
+func (c *Cache[V]) delete(idx uint64, key string, reason EvictReason) {
+	c.mustBeLocked()
+
+	r, _, _ := c.lookup(idx, key)
+	if r == nil {
+		return
+	}
+
+	c.policy.remove(r)
+	c.unlink(idx, key, reason)
+}
+
+// unlink removes the record at key from its hash bucket, stops its TTL timer
+// and fires the eviction callbacks. It leaves the eviction policy's
+// bookkeeping untouched, so callers that evicted the record from the policy
+// themselves (Set, on capacity eviction) should call this directly instead
+// of delete. It must be executed within a cache transaction.
+func (c *Cache[V]) unlink(idx uint64, key string, reason EvictReason) {
 	c.mustBeLocked()
 
 	r, above, root := c.lookup(idx, key)
@@ -146,21 +973,227 @@ func (c *lruCache[V]) delete(idx uint64, key string) {
 		above.below = r.below
 	}
 
-	c.lru.Remove(r.e)
 	c.size--
+	c.bytes -= c.sizeOf(r.key, r.val)
+
+	switch reason {
+	case EvictReasonCapacity:
+		c.evictions.Add(1)
+	case EvictReasonExpired:
+		c.expirations.Add(1)
+	}
+
+	if c.onEvict != nil {
+		c.onEvict(r.key, r.val)
+	}
+	if c.onEvictReason != nil {
+		c.onEvictReason(reason, r.key, r.val)
+	}
 }
 
 // hash implements hash function by using hash/maphash strandard library.
-func (c *lruCache[V]) hash(s string) uint64 {
-	return maphash.String(c.seed, s) % MaxCacheSize
+func (c *Cache[V]) hash(s string) uint64 {
+	return maphash.String(c.seed, s) & c.mask
 }
 
 // mustBeLocked ensures that the caller are running withing a cache transaction
 // (using c.m capability), without acquiring the lock by itself. It's good for
 // safe development.
-func (c *lruCache[V]) mustBeLocked() {
+func (c *Cache[V]) mustBeLocked() {
 	if c.m.TryLock() {
 		c.m.Unlock()
 		panic("the code must be executed within a cache transaction")
 	}
 }
+
+// ShardedCache spreads records across several independent Cache shards, each
+// with its own mutex, so that Get and Set on unrelated keys don't contend
+// on a single lock the way Cache's do. Its public API mirrors Cache, so it
+// drops in transparently.
+type ShardedCache[V any] struct {
+	seed   maphash.Seed
+	mask   uint64
+	shards []*Cache[V]
+}
+
+// NewShardedCache makes a ShardedCache with room for capacity entries in
+// total, split as evenly as possible across shards: any remainder from the
+// division goes one-per-shard to the first shards, so the total matches
+// capacity exactly unless capacity is smaller than the shard count, in
+// which case every shard gets a minimum of one entry and the real total,
+// reported by Cap, ends up larger than requested. WithMaxBytes and
+// WithMinEntries are divided across shards the same way, so the byte
+// budget and the entry floor are shared totals too, not applied per shard.
+// opts otherwise configures every shard the same way NewCache would, and
+// additionally accepts WithShards to pick the number of shards; without it,
+// the next power of two >= runtime.GOMAXPROCS(0) is used.
+func NewShardedCache[V any](capacity int, opts ...Option[V]) (*ShardedCache[V], error) {
+	if capacity <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+
+	o := options[V]{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	n := o.shards
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	shardCount := bucketCountFor(n)
+
+	base := capacity / int(shardCount)
+	remainder := capacity % int(shardCount)
+
+	maxBytesBase := o.maxBytes / int64(shardCount)
+	maxBytesRemainder := o.maxBytes % int64(shardCount)
+
+	minEntriesBase := o.minEntries / int(shardCount)
+	minEntriesRemainder := o.minEntries % int(shardCount)
+
+	shards := make([]*Cache[V], shardCount)
+	for i := range shards {
+		perShard := base
+		if i < remainder {
+			perShard++
+		}
+		if perShard <= 0 {
+			perShard = 1
+		}
+
+		perMaxBytes := maxBytesBase
+		if int64(i) < maxBytesRemainder {
+			perMaxBytes++
+		}
+		if o.maxBytes > 0 && perMaxBytes <= 0 {
+			perMaxBytes = 1
+		}
+
+		perMinEntries := minEntriesBase
+		if i < minEntriesRemainder {
+			perMinEntries++
+		}
+
+		shardOpts := make([]Option[V], len(opts), len(opts)+2)
+		copy(shardOpts, opts)
+		shardOpts = append(shardOpts, WithMaxBytes[V](perMaxBytes), WithMinEntries[V](perMinEntries))
+
+		c, err := NewCache[V](perShard, shardOpts...)
+		if err != nil {
+			return nil, err
+		}
+		shards[i] = c
+	}
+
+	return &ShardedCache[V]{
+		seed:   maphash.MakeSeed(),
+		mask:   shardCount - 1,
+		shards: shards,
+	}, nil
+}
+
+// shardFor returns the shard that owns key.
+func (s *ShardedCache[V]) shardFor(key string) *Cache[V] {
+	return s.shards[maphash.String(s.seed, key)&s.mask]
+}
+
+// Get gets the value corresponding to a requested key. It returns false if
+// the key does not exist.
+func (s *ShardedCache[V]) Get(key string) (V, bool) {
+	return s.shardFor(key).Get(key)
+}
+
+// Set sets a new (key, value, ttl) record in the cache, routed to key's
+// shard. See Cache.Set.
+func (s *ShardedCache[V]) Set(key string, value V, ttl time.Duration) {
+	s.shardFor(key).Set(key, value, ttl)
+}
+
+// GetOrLoad returns the cached value for key, loading it via loader on a
+// miss. See Cache.GetOrLoad.
+func (s *ShardedCache[V]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context, key string) (V, error)) (V, error) {
+	return s.shardFor(key).GetOrLoad(ctx, key, ttl, loader)
+}
+
+// Delete removes key from the cache. It reports whether the key was
+// present.
+func (s *ShardedCache[V]) Delete(key string) bool {
+	return s.shardFor(key).Delete(key)
+}
+
+// Remove is a synonym for Delete.
+func (s *ShardedCache[V]) Remove(key string) bool {
+	return s.shardFor(key).Remove(key)
+}
+
+// Len returns the number of records currently in the cache, summed across
+// all shards.
+func (s *ShardedCache[V]) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Cap returns the cache's capacity, summed across all shards.
+func (s *ShardedCache[V]) Cap() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Cap()
+	}
+	return n
+}
+
+// Stats aggregates the counters of every shard.
+func (s *ShardedCache[V]) Stats() Stats {
+	var total Stats
+	for _, shard := range s.shards {
+		st := shard.Stats()
+		total.Hits += st.Hits
+		total.Misses += st.Misses
+		total.Evictions += st.Evictions
+		total.Expirations += st.Expirations
+	}
+	return total
+}
+
+// Keys returns every key currently in the cache. Each shard's keys are
+// ordered from most to least recently used, but that order isn't preserved
+// across shards.
+func (s *ShardedCache[V]) Keys() []string {
+	var keys []string
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// Range calls f for every record across all shards, until f returns false
+// or every record has been visited. f must not call back into the cache.
+func (s *ShardedCache[V]) Range(f func(key string, v V) bool) {
+	for _, shard := range s.shards {
+		keepGoing := true
+		shard.Range(func(key string, v V) bool {
+			keepGoing = f(key, v)
+			return keepGoing
+		})
+		if !keepGoing {
+			return
+		}
+	}
+}
+
+// Peek returns the value for key, like Get, but without marking it as
+// recently used.
+func (s *ShardedCache[V]) Peek(key string) (V, bool) {
+	return s.shardFor(key).Peek(key)
+}
+
+// Purge removes every record from every shard.
+func (s *ShardedCache[V]) Purge() {
+	for _, shard := range s.shards {
+		shard.Purge()
+	}
+}
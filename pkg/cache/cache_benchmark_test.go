@@ -8,8 +8,20 @@ import (
 	"github.com/sorushp/cache/pkg/cache"
 )
 
+const benchCacheSize = 5
+
+func newBenchCache(b *testing.B) *cache.Cache[string] {
+	b.Helper()
+
+	c, err := cache.NewCache[string](1000)
+	if err != nil {
+		b.Fatalf("NewCache: %v", err)
+	}
+	return c
+}
+
 func BenchmarkCache_Set(b *testing.B) {
-	c := cache.NewCache[string]()
+	c := newBenchCache(b)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		c.Set("key"+strconv.Itoa(i), "value", 5*time.Second)
@@ -17,7 +29,7 @@ func BenchmarkCache_Set(b *testing.B) {
 }
 
 func BenchmarkCache_Get(b *testing.B) {
-	c := cache.NewCache[string]()
+	c := newBenchCache(b)
 	for i := 0; i < 1000; i++ {
 		c.Set("key"+strconv.Itoa(i), "value", 5*time.Second)
 	}
@@ -29,15 +41,18 @@ func BenchmarkCache_Get(b *testing.B) {
 }
 
 func BenchmarkCache_SetAndEvict(b *testing.B) {
-	c := cache.NewCache[string]()
-	for i := 0; i < cache.MaxCacheSize; i++ {
+	c, err := cache.NewCache[string](benchCacheSize)
+	if err != nil {
+		b.Fatalf("NewCache: %v", err)
+	}
+	for i := 0; i < benchCacheSize; i++ {
 		key := "key" + strconv.Itoa(i)
 		c.Set(key, "value", 5*time.Second)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		key := "key" + strconv.Itoa(cache.MaxCacheSize+i)
+		key := "key" + strconv.Itoa(benchCacheSize+i)
 		c.Set(key, "value", 5*time.Second)
 	}
 }
@@ -1,17 +1,33 @@
 package cache_test
 
 import (
+	"context"
+	"errors"
 	"math/rand/v2"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/sorushp/cache/pkg/cache"
 )
 
+// testCacheSize is the capacity used across this file's tests.
+const testCacheSize = 5
+
+func newCache(t *testing.T) *cache.Cache[string] {
+	t.Helper()
+
+	c, err := cache.NewCache[string](testCacheSize)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	return c
+}
+
 func TestCache_SetAndGet(t *testing.T) {
-	c := cache.NewCache[string]()
+	c := newCache(t)
 
 	c.Set("key1", "value1", 5*time.Second)
 	c.Set("key2", "value2", 5*time.Second)
@@ -30,7 +46,7 @@ func TestCache_SetAndGet(t *testing.T) {
 }
 
 func TestCache_Expiration(t *testing.T) {
-	c := cache.NewCache[string]()
+	c := newCache(t)
 
 	c.Set("key1", "value1", 2*time.Second)
 	time.Sleep(3 * time.Second)
@@ -40,11 +56,11 @@ func TestCache_Expiration(t *testing.T) {
 	}
 }
 
-// For this test, cache.MaxCacheSize >= 2 is mandatory
+// For this test, testCacheSize >= 2 is mandatory
 func TestCache_LRU(t *testing.T) {
-	c := cache.NewCache[string]()
+	c := newCache(t)
 
-	for i := 1; i <= cache.MaxCacheSize+1; i++ { // The last iteration (i == maxCacheSize+1) should evict "key1"
+	for i := 1; i <= testCacheSize+1; i++ { // The last iteration (i == testCacheSize+1) should evict "key1"
 		n := strconv.Itoa(i)
 		c.Set("key"+n, "value"+n, 5*time.Second)
 	}
@@ -58,7 +74,7 @@ func TestCache_LRU(t *testing.T) {
 		t.Errorf("expected 'value2', got '%v'", val)
 	}
 
-	n := strconv.Itoa(cache.MaxCacheSize + 2)
+	n := strconv.Itoa(testCacheSize + 2)
 	c.Set("key"+n, "value"+n, 5*time.Second) // This should evict "key3"
 
 	if _, ok := c.Get("key3"); ok {
@@ -67,10 +83,10 @@ func TestCache_LRU(t *testing.T) {
 }
 
 func TestCache_ConcurrentSetAndGet(t *testing.T) {
-	c := cache.NewCache[string]()
+	c := newCache(t)
 
 	var wg sync.WaitGroup
-	numGoroutines := cache.MaxCacheSize
+	numGoroutines := testCacheSize
 
 	// Concurrently setting values
 	wg.Add(numGoroutines)
@@ -99,11 +115,462 @@ func TestCache_ConcurrentSetAndGet(t *testing.T) {
 	wg.Wait()
 }
 
+func TestNewCacheWithPolicy(t *testing.T) {
+	c, err := cache.NewCacheWithPolicy[string](testCacheSize, cache.PolicyARC)
+	if err != nil {
+		t.Fatalf("NewCacheWithPolicy: %v", err)
+	}
+
+	for i := 1; i <= testCacheSize; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	c.Get("key1")
+	for i := testCacheSize + 1; i <= testCacheSize+8; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	if val, ok := c.Get("key1"); !ok || val != "value1" {
+		t.Errorf("expected frequently used 'key1' to survive under ARC, got %v, %v", val, ok)
+	}
+}
+
+func TestCache_SievePolicy(t *testing.T) {
+	c, err := cache.NewCache[string](testCacheSize, cache.WithPolicy[string](cache.PolicySieve))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	for i := 1; i <= testCacheSize; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	// Touching key1 and key2 marks them visited, so the next eviction should
+	// skip over them and take the untouched key3 instead.
+	c.Get("key1")
+	c.Get("key2")
+
+	c.Set("key6", "value6", 5*time.Second)
+
+	if _, ok := c.Get("key3"); ok {
+		t.Error("expected 'key3' to be evicted")
+	}
+	if _, ok := c.Get("key1"); !ok {
+		t.Error("expected 'key1' to survive eviction")
+	}
+	if _, ok := c.Get("key2"); !ok {
+		t.Error("expected 'key2' to survive eviction")
+	}
+}
+
+func TestCache_TwoQPolicy(t *testing.T) {
+	c, err := cache.NewCache[string](testCacheSize, cache.WithPolicy[string](cache.Policy2Q))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	for i := 1; i <= testCacheSize; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	n := strconv.Itoa(testCacheSize + 1)
+	c.Set("key"+n, "value"+n, 5*time.Second) // evicts 'key1' from A1in straight to the A1out ghost list
+
+	if _, ok := c.Get("key1"); ok {
+		t.Error("expected 'key1' to be evicted")
+	}
+
+	// Re-adding key1 should be recognized as a ghost hit and promoted to Am,
+	// so it survives further A1in churn.
+	c.Set("key1", "value1-again", 5*time.Second)
+	for i := testCacheSize + 2; i <= testCacheSize+5; i++ {
+		m := strconv.Itoa(i)
+		c.Set("key"+m, "value"+m, 5*time.Second)
+	}
+	if val, ok := c.Get("key1"); !ok || val != "value1-again" {
+		t.Errorf("expected 'key1' (promoted to Am) to survive, got %v, %v", val, ok)
+	}
+}
+
+func TestCache_ARCPolicy(t *testing.T) {
+	c, err := cache.NewCache[string](testCacheSize, cache.WithPolicy[string](cache.PolicyARC))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	for i := 1; i <= testCacheSize; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	// Access key1 and key2 once each, which promotes them to T2 (frequent).
+	c.Get("key1")
+	c.Get("key2")
+
+	// Scan through enough new keys to evict from T1.
+	for i := testCacheSize + 1; i <= testCacheSize+8; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	if val, ok := c.Get("key1"); !ok || val != "value1" {
+		t.Errorf("expected frequently used 'key1' to survive the scan, got %v, %v", val, ok)
+	}
+	if val, ok := c.Get("key2"); !ok || val != "value2" {
+		t.Errorf("expected frequently used 'key2' to survive the scan, got %v, %v", val, ok)
+	}
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	c, err := cache.NewCache[[]byte](100, cache.WithMaxBytes[[]byte](10))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	c.Set("a", []byte("12345"), 5*time.Second)
+	c.Set("b", []byte("12345"), 5*time.Second)
+
+	// Both fit exactly within the 10-byte budget.
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected 'a' to still be present")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("expected 'b' to still be present")
+	}
+
+	// Adding a third 5-byte entry must evict one to stay within budget.
+	c.Set("c", []byte("12345"), 5*time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected 'a' to be evicted to respect the byte budget")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("expected 'c' to be present")
+	}
+}
+
+func TestCache_MaxBytes_Reset(t *testing.T) {
+	c, err := cache.NewCache[[]byte](100, cache.WithMaxBytes[[]byte](10))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	c.Set("a", []byte("12345"), 5*time.Second)
+	c.Set("b", []byte("12345"), 5*time.Second)
+
+	// Resetting 'a' to a much larger value must evict to stay within budget,
+	// not just grow past it.
+	c.Set("a", []byte("1234567890"), 5*time.Second)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected 'b' to be evicted to make room for the resized 'a'")
+	}
+	if val, ok := c.Get("a"); !ok || len(val) != 10 {
+		t.Errorf("expected 'a' to hold the resized 10-byte value, got %q, %v", val, ok)
+	}
+}
+
+func TestCache_MaxBytes_MinEntries(t *testing.T) {
+	c, err := cache.NewCache[[]byte](100,
+		cache.WithMaxBytes[[]byte](1),
+		cache.WithMinEntries[[]byte](1),
+	)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	c.Set("a", []byte("oversized"), 5*time.Second)
+	c.Set("b", []byte("also-oversized"), 5*time.Second)
+
+	if _, ok := c.Get("b"); !ok {
+		t.Error("expected 'b' to be present despite exceeding the byte budget alone, due to minEntries")
+	}
+}
+
+func TestNewCache_MissingSizer(t *testing.T) {
+	if _, err := cache.NewCache[int](10, cache.WithMaxBytes[int](100)); err != cache.ErrMissingSizer {
+		t.Errorf("expected ErrMissingSizer, got %v", err)
+	}
+}
+
+func TestShardedCache_SetAndGet(t *testing.T) {
+	c, err := cache.NewShardedCache[string](100, cache.WithShards[string](4))
+	if err != nil {
+		t.Fatalf("NewShardedCache: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	if c.Len() != 50 {
+		t.Errorf("expected Len() == 50, got %d", c.Len())
+	}
+
+	for i := 0; i < 50; i++ {
+		n := strconv.Itoa(i)
+		if val, ok := c.Get("key" + n); !ok || val != "value"+n {
+			t.Errorf("expected 'value%s', got %q, %v", n, val, ok)
+		}
+	}
+
+	st := c.Stats()
+	if st.Hits != 50 {
+		t.Errorf("expected 50 hits, got %d", st.Hits)
+	}
+
+	if !c.Delete("key0") {
+		t.Error("expected 'key0' to have been deleted")
+	}
+	if _, ok := c.Get("key0"); ok {
+		t.Error("expected 'key0' to be gone after Delete")
+	}
+	if c.Len() != 49 {
+		t.Errorf("expected Len() == 49 after delete, got %d", c.Len())
+	}
+}
+
+func TestShardedCache_MaxBytes(t *testing.T) {
+	c, err := cache.NewShardedCache[[]byte](1000, cache.WithShards[[]byte](8), cache.WithMaxBytes[[]byte](80))
+	if err != nil {
+		t.Fatalf("NewShardedCache: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, []byte("12345"), 5*time.Second)
+	}
+
+	var totalBytes int
+	c.Range(func(k string, v []byte) bool {
+		totalBytes += len(v)
+		return true
+	})
+
+	// 80 divides evenly across 8 shards, so the total across all shards
+	// should match the configured budget exactly, not 8x it.
+	if totalBytes > 80 {
+		t.Errorf("expected total resident bytes <= 80 (the shared budget), got %d", totalBytes)
+	}
+}
+
+func TestNewShardedCache_CapacityRemainder(t *testing.T) {
+	// WithShards(6) rounds up to 8 shards, and 100 doesn't divide evenly
+	// across 8: the remainder should be distributed instead of dropped, so
+	// Cap() reports the exact total, not a rounded-down one.
+	c, err := cache.NewShardedCache[string](100, cache.WithShards[string](6))
+	if err != nil {
+		t.Fatalf("NewShardedCache: %v", err)
+	}
+
+	if c.Cap() != 100 {
+		t.Errorf("expected Cap() == 100, got %d", c.Cap())
+	}
+}
+
+func TestNewShardedCache_CapacitySmallerThanShards(t *testing.T) {
+	// With fewer entries requested than shards, every shard still gets a
+	// minimum of one, so the real (and reported) total exceeds capacity.
+	c, err := cache.NewShardedCache[string](3, cache.WithShards[string](8))
+	if err != nil {
+		t.Fatalf("NewShardedCache: %v", err)
+	}
+
+	if c.Cap() != 8 {
+		t.Errorf("expected Cap() == 8 (one per shard, minimum), got %d", c.Cap())
+	}
+}
+
+func TestCache_GetOrLoad_Dedup(t *testing.T) {
+	c := newCache(t)
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	numGoroutines := 10
+	results := make([]string, numGoroutines)
+	for i := range numGoroutines {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := c.GetOrLoad(context.Background(), "key", 5*time.Second, func(ctx context.Context, key string) (string, error) {
+				calls.Add(1)
+				<-release
+				return "loaded", nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = v
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected loader to be called exactly once, got %d", calls.Load())
+	}
+	for i, v := range results {
+		if v != "loaded" {
+			t.Errorf("result %d: expected 'loaded', got %q", i, v)
+		}
+	}
+
+	if v, ok := c.Get("key"); !ok || v != "loaded" {
+		t.Errorf("expected cache to hold 'loaded', got %q, %v", v, ok)
+	}
+}
+
+func TestCache_GetOrLoad_ContextCancellation(t *testing.T) {
+	c := newCache(t)
+
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(ctx, "key", 5*time.Second, func(ctx context.Context, key string) (string, error) {
+			<-release
+			return "loaded", nil
+		})
+		done <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetOrLoad did not return after context cancellation")
+	}
+
+	// The in-flight load is not aborted by a waiter's cancellation; it still
+	// completes and populates the cache for everyone else.
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if v, ok := c.Get("key"); !ok || v != "loaded" {
+		t.Errorf("expected the in-flight load to still populate 'loaded', got %q, %v", v, ok)
+	}
+}
+
+func TestCache_KeysRangePeekPurge(t *testing.T) {
+	c := newCache(t)
+
+	for i := 1; i <= 3; i++ {
+		n := strconv.Itoa(i)
+		c.Set("key"+n, "value"+n, 5*time.Second)
+	}
+
+	if c.Cap() != testCacheSize {
+		t.Errorf("expected Cap() == %d, got %d", testCacheSize, c.Cap())
+	}
+
+	// Peek must not disturb LRU order.
+	if v, ok := c.Peek("key1"); !ok || v != "value1" {
+		t.Errorf("expected Peek to find 'value1', got %q, %v", v, ok)
+	}
+
+	keys := c.Keys()
+	want := []string{"key3", "key2", "key1"}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %d keys, got %v", len(want), keys)
+	}
+	for i, k := range want {
+		if keys[i] != k {
+			t.Errorf("expected keys[%d] == %q, got %q (Peek should not affect recency)", i, k, keys[i])
+		}
+	}
+
+	var seen []string
+	c.Range(func(k string, v string) bool {
+		seen = append(seen, k)
+		return true
+	})
+	if len(seen) != 3 {
+		t.Errorf("expected Range to visit 3 records, got %d", len(seen))
+	}
+
+	stopped := 0
+	c.Range(func(k string, v string) bool {
+		stopped++
+		return false
+	})
+	if stopped != 1 {
+		t.Errorf("expected Range to stop after the first false return, got %d", stopped)
+	}
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("expected Len() == 0 after Purge, got %d", c.Len())
+	}
+	if _, ok := c.Get("key1"); ok {
+		t.Error("expected 'key1' to be gone after Purge")
+	}
+}
+
+func TestCache_StatsAndOnEvict(t *testing.T) {
+	type evt struct {
+		reason cache.EvictReason
+		key    string
+	}
+	var events []evt
+	c, err := cache.NewCache[string](2, cache.WithOnEvict(func(reason cache.EvictReason, key string, v string) {
+		events = append(events, evt{reason, key})
+	}))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	c.Set("a", "1", 5*time.Second)
+	c.Set("b", "2", 5*time.Second)
+	c.Set("c", "3", 5*time.Second) // evicts 'a' on capacity
+
+	if st := c.Stats(); st.Evictions != 1 {
+		t.Errorf("expected 1 eviction, got %d", st.Evictions)
+	}
+
+	c.Remove("b")
+	if st := c.Stats(); st.Evictions != 1 {
+		t.Errorf("expected evictions to stay at 1 after Remove, got %d", st.Evictions)
+	}
+
+	found := map[cache.EvictReason]bool{}
+	for _, e := range events {
+		found[e.reason] = true
+	}
+	if !found[cache.EvictReasonCapacity] {
+		t.Error("expected an EvictReasonCapacity event")
+	}
+	if !found[cache.EvictReasonDeleted] {
+		t.Error("expected an EvictReasonDeleted event")
+	}
+}
+
+func TestCache_Stats_Expirations(t *testing.T) {
+	c := newCache(t)
+
+	c.Set("key1", "value1", 50*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	if st := c.Stats(); st.Expirations != 1 {
+		t.Errorf("expected 1 expiration, got %d", st.Expirations)
+	}
+}
+
 func TestCache_ConcurrentSetAndExpire(t *testing.T) {
-	c := cache.NewCache[string]()
+	c := newCache(t)
 
 	var wg sync.WaitGroup
-	numGoroutines := cache.MaxCacheSize
+	numGoroutines := testCacheSize
 	numIterations := 5
 
 	tOffset := 100 * time.Millisecond
@@ -5,8 +5,28 @@ import (
 	"time"
 )
 
+func newTestCache(t *testing.T, capacity int) *Cache[string] {
+	t.Helper()
+
+	c, err := NewCache[string](capacity)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	return c
+}
+
+func TestNewCache_InvalidCapacity(t *testing.T) {
+	if _, err := NewCache[string](0); err != ErrInvalidCapacity {
+		t.Errorf("expected ErrInvalidCapacity, got %v", err)
+	}
+
+	if _, err := NewCache[string](-1); err != ErrInvalidCapacity {
+		t.Errorf("expected ErrInvalidCapacity, got %v", err)
+	}
+}
+
 func TestLookup(t *testing.T) {
-	c := NewCache[string]()
+	c := newTestCache(t, 5)
 
 	c.Set("key1", "value1", 5*time.Second)
 	c.Set("key2", "value2", 5*time.Second)
@@ -32,7 +52,7 @@ func TestLookup(t *testing.T) {
 }
 
 func TestDelete(t *testing.T) {
-	c := NewCache[string]()
+	c := newTestCache(t, 5)
 
 	c.Set("key1", "value1", 5*time.Second)
 	c.Set("key2", "value2", 5*time.Second)
@@ -40,7 +60,7 @@ func TestDelete(t *testing.T) {
 
 	// Deleting an existing key
 	c.m.Lock()
-	c.delete(c.hash("key2"), "key2")
+	c.delete(c.hash("key2"), "key2", EvictReasonDeleted)
 	if c.size != 2 {
 		t.Errorf("failed for cache size, expected 2, got %v", c.size)
 	}
@@ -58,3 +78,22 @@ func TestDelete(t *testing.T) {
 		t.Errorf("lookup should not find 'key2', got '%v'", r)
 	}
 }
+
+func TestDelete_EvictionCallback(t *testing.T) {
+	var evicted []string
+	c, err := NewCache[string](5, WithEvictionCallback(func(k string, v string) {
+		evicted = append(evicted, k+"="+v)
+	}))
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	c.Set("key1", "value1", 5*time.Second)
+	c.m.Lock()
+	c.delete(c.hash("key1"), "key1", EvictReasonDeleted)
+	c.m.Unlock()
+
+	if len(evicted) != 1 || evicted[0] != "key1=value1" {
+		t.Errorf("expected eviction callback to fire once for 'key1=value1', got %v", evicted)
+	}
+}